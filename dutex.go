@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type reader struct {
+	version    uint64
+	expiration time.Time
+	source     string
+	owner      string
+	acquired   time.Time
+	client     string
+}
+
+type Resource struct {
+	readers    []reader
+	writer     uint64
+	expiration time.Time
+	uid        string
+	source     string
+	owner      string
+	acquired   time.Time
+	client     string
+}
+
+// hasWriter reports whether the resource is currently held exclusively.
+func (resource Resource) hasWriter(now time.Time) bool {
+	return resource.writer != 0 && now.Before(resource.expiration)
+}
+
+// hasReader reports whether the resource is currently held by any reader.
+func (resource Resource) hasReader(now time.Time) bool {
+	for _, reader := range resource.readers {
+		if now.Before(reader.expiration) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dutex is the in-process lock table. It is reached over the network through
+// the REST handlers in server.go, but can also be driven directly in tests or
+// other in-process callers via localLocker.
+type Dutex struct {
+	mutex   sync.Mutex
+	locked  map[string]Resource
+	version uint64
+}
+
+func newDutex() *Dutex {
+	return &Dutex{locked: make(map[string]Resource)}
+}
+
+type LockArg struct {
+	Resource string
+	Lifetime time.Duration
+	// UID identifies the caller that acquired the lock, so a quorum client
+	// fanning the same Lock call out to several servers can be traced back
+	// to the servers that granted it. Optional; leave empty when unused.
+	UID string
+	// Source and Owner are caller-supplied diagnostic tags (e.g. a file:line
+	// or a user name) surfaced later through List, to help an operator find
+	// the process responsible for a stuck lock. Both are optional.
+	Source string
+	Owner  string
+}
+
+type LockReply struct {
+	Version uint64
+}
+
+// Lock acquires arg.Resource exclusively. clientAddress is the network
+// address of the caller, recorded alongside arg.Source and arg.Owner so List
+// can later attribute the lock without scraping logs.
+func (dutex *Dutex) Lock(arg LockArg, clientAddress string) (LockReply, error) {
+	dutex.mutex.Lock()
+	defer dutex.mutex.Unlock()
+
+	now := time.Now()
+	previous, ok := dutex.locked[arg.Resource]
+	if ok && (previous.hasWriter(now) || previous.hasReader(now)) {
+		return LockReply{}, fmt.Errorf("%s is already locked.", arg.Resource)
+	}
+
+	dutex.version++
+	dutex.locked[arg.Resource] = Resource{
+		writer:     dutex.version,
+		expiration: now.Add(arg.Lifetime),
+		uid:        arg.UID,
+		source:     arg.Source,
+		owner:      arg.Owner,
+		acquired:   now,
+		client:     clientAddress,
+	}
+
+	return LockReply{dutex.version}, nil
+}
+
+type UnlockArg struct {
+	Resource string
+	Version  uint64
+}
+
+type UnlockReply struct{}
+
+func (dutex *Dutex) Unlock(arg UnlockArg) (UnlockReply, error) {
+	dutex.mutex.Lock()
+	defer dutex.mutex.Unlock()
+
+	previous, ok := dutex.locked[arg.Resource]
+	if !ok || previous.writer == 0 {
+		return UnlockReply{}, fmt.Errorf("%s is already unlocked", arg.Resource)
+	}
+	if arg.Version != previous.writer {
+		return UnlockReply{}, fmt.Errorf("expected version %d, got version %d",
+			uint64(previous.writer),
+			uint64(arg.Version))
+	}
+
+	previous.writer = 0
+	if len(previous.readers) == 0 {
+		delete(dutex.locked, arg.Resource)
+	} else {
+		dutex.locked[arg.Resource] = previous
+	}
+	return UnlockReply{}, nil
+}
+
+type RefreshArg struct {
+	Resource string
+	Version  uint64
+	Lifetime time.Duration
+}
+
+type RefreshReply struct{}
+
+// Refresh extends the expiration of a held writer lock without releasing it,
+// so a long-running operation does not have to guess a lifetime up front or
+// race a waiter by unlocking and relocking.
+func (dutex *Dutex) Refresh(arg RefreshArg) (RefreshReply, error) {
+	dutex.mutex.Lock()
+	defer dutex.mutex.Unlock()
+
+	now := time.Now()
+	previous, ok := dutex.locked[arg.Resource]
+	if !ok || !previous.hasWriter(now) {
+		return RefreshReply{}, fmt.Errorf("%s is already unlocked", arg.Resource)
+	}
+	if arg.Version != previous.writer {
+		return RefreshReply{}, fmt.Errorf("expected version %d, got version %d",
+			uint64(previous.writer),
+			uint64(arg.Version))
+	}
+
+	previous.expiration = now.Add(arg.Lifetime)
+	dutex.locked[arg.Resource] = previous
+	return RefreshReply{}, nil
+}
+
+type RLockArg struct {
+	Resource string
+	Lifetime time.Duration
+	// Source and Owner mirror LockArg's diagnostic tags, surfaced per reader
+	// token through List.
+	Source string
+	Owner  string
+}
+
+type RLockReply struct {
+	Version uint64
+}
+
+// RLock acquires a shared read lock on arg.Resource. clientAddress is the
+// network address of the caller, recorded alongside arg.Source and arg.Owner
+// so List can attribute this reader without scraping logs.
+func (dutex *Dutex) RLock(arg RLockArg, clientAddress string) (RLockReply, error) {
+	dutex.mutex.Lock()
+	defer dutex.mutex.Unlock()
+
+	now := time.Now()
+	previous, ok := dutex.locked[arg.Resource]
+	if ok && previous.hasWriter(now) {
+		return RLockReply{}, fmt.Errorf("%s is already locked.", arg.Resource)
+	}
+
+	dutex.version++
+
+	live := make([]reader, 0, len(previous.readers)+1)
+	for _, existing := range previous.readers {
+		if now.Before(existing.expiration) {
+			live = append(live, existing)
+		}
+	}
+	live = append(live, reader{
+		version:    dutex.version,
+		expiration: now.Add(arg.Lifetime),
+		source:     arg.Source,
+		owner:      arg.Owner,
+		acquired:   now,
+		client:     clientAddress,
+	})
+
+	dutex.locked[arg.Resource] = Resource{readers: live}
+
+	return RLockReply{dutex.version}, nil
+}
+
+type RUnlockArg struct {
+	Resource string
+	Version  uint64
+}
+
+type RUnlockReply struct{}
+
+func (dutex *Dutex) RUnlock(arg RUnlockArg) (RUnlockReply, error) {
+	dutex.mutex.Lock()
+	defer dutex.mutex.Unlock()
+
+	previous, ok := dutex.locked[arg.Resource]
+	if !ok {
+		return RUnlockReply{}, fmt.Errorf("%s is already unlocked", arg.Resource)
+	}
+
+	index := -1
+	for i, reader := range previous.readers {
+		if reader.version == arg.Version {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return RUnlockReply{}, fmt.Errorf("reader version %d of %s is already unlocked", arg.Version, arg.Resource)
+	}
+
+	previous.readers = append(previous.readers[:index], previous.readers[index+1:]...)
+	if len(previous.readers) == 0 && previous.writer == 0 {
+		delete(dutex.locked, arg.Resource)
+	} else {
+		dutex.locked[arg.Resource] = previous
+	}
+	return RUnlockReply{}, nil
+}
+
+type LockBatchArg struct {
+	Resources []string
+	Lifetime  time.Duration
+	// Source and Owner are caller-supplied diagnostic tags, recorded on every
+	// resource in the batch the same way LockArg's do. Both are optional.
+	Source string
+	Owner  string
+}
+
+type LockBatchReply struct {
+	Versions map[string]uint64
+}
+
+// LockBatch acquires every resource in arg.Resources or none of them. Resources
+// are sorted before acquisition so that two callers requesting overlapping sets
+// in different orders can never deadlock against each other. clientAddress is
+// the network address of the caller, recorded alongside arg.Source and
+// arg.Owner so List can later attribute the lock without scraping logs.
+func (dutex *Dutex) LockBatch(arg LockBatchArg, clientAddress string) (LockBatchReply, error) {
+	dutex.mutex.Lock()
+	defer dutex.mutex.Unlock()
+
+	resources := append([]string(nil), arg.Resources...)
+	sort.Strings(resources)
+
+	now := time.Now()
+	expiration := now.Add(arg.Lifetime)
+	versions := make(map[string]uint64, len(resources))
+
+	for _, resource := range resources {
+		previous, ok := dutex.locked[resource]
+		if ok && (previous.hasWriter(now) || previous.hasReader(now)) {
+			for acquired := range versions {
+				delete(dutex.locked, acquired)
+			}
+			return LockBatchReply{}, fmt.Errorf("%s is already locked.", resource)
+		}
+
+		dutex.version++
+		dutex.locked[resource] = Resource{
+			writer:     dutex.version,
+			expiration: expiration,
+			source:     arg.Source,
+			owner:      arg.Owner,
+			acquired:   now,
+			client:     clientAddress,
+		}
+		versions[resource] = dutex.version
+	}
+
+	return LockBatchReply{versions}, nil
+}
+
+type UnlockBatchArg struct {
+	Resources []string
+	Versions  map[string]uint64
+}
+
+type UnlockBatchReply struct{}
+
+func (dutex *Dutex) UnlockBatch(arg UnlockBatchArg) (UnlockBatchReply, error) {
+	dutex.mutex.Lock()
+	defer dutex.mutex.Unlock()
+
+	for _, resource := range arg.Resources {
+		previous, ok := dutex.locked[resource]
+		if !ok || previous.writer == 0 {
+			return UnlockBatchReply{}, fmt.Errorf("%s is already unlocked", resource)
+		}
+		if arg.Versions[resource] != previous.writer {
+			return UnlockBatchReply{}, fmt.Errorf("expected version %d, got version %d",
+				uint64(previous.writer),
+				uint64(arg.Versions[resource]))
+		}
+	}
+
+	for _, resource := range arg.Resources {
+		delete(dutex.locked, resource)
+	}
+	return UnlockBatchReply{}, nil
+}
+
+type ListEntry struct {
+	Resource string
+	// Mode is "writer" for an exclusive Lock or "reader" for one of
+	// potentially several concurrent RLock holders.
+	Mode       string
+	Version    uint64
+	UID        string
+	Source     string
+	Owner      string
+	Acquired   time.Time
+	Expiration time.Time
+	Client     string
+}
+
+type ListReply struct {
+	Resources []ListEntry
+}
+
+// List returns every resource currently held, whether by a writer or by one
+// or more readers, so an operator can diagnose a stuck lock without
+// restarting the server or scraping logs.
+func (dutex *Dutex) List() ListReply {
+	dutex.mutex.Lock()
+	defer dutex.mutex.Unlock()
+
+	now := time.Now()
+	var entries []ListEntry
+	for resource, locked := range dutex.locked {
+		if locked.hasWriter(now) {
+			entries = append(entries, ListEntry{
+				Resource:   resource,
+				Mode:       "writer",
+				Version:    locked.writer,
+				UID:        locked.uid,
+				Source:     locked.source,
+				Owner:      locked.owner,
+				Acquired:   locked.acquired,
+				Expiration: locked.expiration,
+				Client:     locked.client,
+			})
+		}
+
+		for _, reader := range locked.readers {
+			if !now.Before(reader.expiration) {
+				continue
+			}
+			entries = append(entries, ListEntry{
+				Resource:   resource,
+				Mode:       "reader",
+				Version:    reader.version,
+				Source:     reader.source,
+				Owner:      reader.owner,
+				Acquired:   reader.acquired,
+				Expiration: reader.expiration,
+				Client:     reader.client,
+			})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Resource != entries[j].Resource {
+			return entries[i].Resource < entries[j].Resource
+		}
+		return entries[i].Version < entries[j].Version
+	})
+
+	return ListReply{entries}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockBlocksWhileReaderHeld(t *testing.T) {
+	dutex := newDutex()
+
+	if _, error := dutex.RLock(RLockArg{Resource: "a", Lifetime: time.Minute}, "client"); error != nil {
+		t.Fatalf("RLock: %v", error)
+	}
+
+	if _, error := dutex.Lock(LockArg{Resource: "a", Lifetime: time.Minute}, "client"); error == nil {
+		t.Fatalf("expected Lock to fail while a reader holds the resource")
+	}
+}
+
+func TestRLockBlocksWhileWriterHeld(t *testing.T) {
+	dutex := newDutex()
+
+	lockReply, error := dutex.Lock(LockArg{Resource: "a", Lifetime: time.Minute}, "client")
+	if error != nil {
+		t.Fatalf("Lock: %v", error)
+	}
+
+	if _, error := dutex.RLock(RLockArg{Resource: "a", Lifetime: time.Minute}, "client"); error == nil {
+		t.Fatalf("expected RLock to fail while the writer holds the resource")
+	}
+
+	if _, error := dutex.Unlock(UnlockArg{Resource: "a", Version: lockReply.Version}); error != nil {
+		t.Fatalf("Unlock: %v", error)
+	}
+
+	if _, error := dutex.RLock(RLockArg{Resource: "a", Lifetime: time.Minute}, "client"); error != nil {
+		t.Fatalf("expected RLock to succeed after Unlock, got: %v", error)
+	}
+}
+
+func TestRLockAllowsMultipleReaders(t *testing.T) {
+	dutex := newDutex()
+
+	if _, error := dutex.RLock(RLockArg{Resource: "a", Lifetime: time.Minute}, "client-1"); error != nil {
+		t.Fatalf("first RLock: %v", error)
+	}
+	if _, error := dutex.RLock(RLockArg{Resource: "a", Lifetime: time.Minute}, "client-2"); error != nil {
+		t.Fatalf("second RLock: %v", error)
+	}
+}
+
+func TestLockBatchRollsBackOnConflict(t *testing.T) {
+	dutex := newDutex()
+
+	if _, error := dutex.Lock(LockArg{Resource: "c", Lifetime: time.Minute}, "client"); error != nil {
+		t.Fatalf("Lock: %v", error)
+	}
+
+	_, error := dutex.LockBatch(LockBatchArg{Resources: []string{"a", "b", "c"}, Lifetime: time.Minute}, "client")
+	if error == nil {
+		t.Fatalf("expected LockBatch to fail because c is already locked")
+	}
+	if !strings.Contains(error.Error(), "c") {
+		t.Fatalf("expected error to name the conflicting resource, got: %v", error)
+	}
+
+	if _, error := dutex.Lock(LockArg{Resource: "a", Lifetime: time.Minute}, "client"); error != nil {
+		t.Fatalf("expected a to be lockable after rollback, got: %v", error)
+	}
+	if _, error := dutex.Lock(LockArg{Resource: "b", Lifetime: time.Minute}, "client"); error != nil {
+		t.Fatalf("expected b to be lockable after rollback, got: %v", error)
+	}
+}
+
+func TestLockBatchSortsToAvoidDeadlock(t *testing.T) {
+	dutex := newDutex()
+
+	reply, error := dutex.LockBatch(LockBatchArg{Resources: []string{"z", "a", "m"}, Lifetime: time.Minute}, "client")
+	if error != nil {
+		t.Fatalf("LockBatch: %v", error)
+	}
+	for _, resource := range []string{"z", "a", "m"} {
+		if _, ok := reply.Versions[resource]; !ok {
+			t.Fatalf("expected a version for %s", resource)
+		}
+	}
+	if !(reply.Versions["a"] < reply.Versions["m"] && reply.Versions["m"] < reply.Versions["z"]) {
+		t.Fatalf("expected versions to be granted in sorted order, got %v", reply.Versions)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// NetLocker is the client-facing view of a dutex lock table. It is satisfied
+// both by localLocker, which drives a *Dutex in-process, and by httpLocker,
+// which reaches one over the REST API. Callers that only need NetLocker can
+// be tested against a fake implementation without spinning up a listener.
+type NetLocker interface {
+	Lock(ctx context.Context, resource string, lifetime time.Duration) (uint64, error)
+	Unlock(ctx context.Context, resource string, version uint64) error
+	RLock(ctx context.Context, resource string, lifetime time.Duration) (uint64, error)
+	RUnlock(ctx context.Context, resource string, version uint64) error
+	Refresh(ctx context.Context, resource string, version uint64, lifetime time.Duration) error
+	Close() error
+}
+
+type localLocker struct {
+	dutex *Dutex
+}
+
+func newLocalLocker(dutex *Dutex) *localLocker {
+	return &localLocker{dutex}
+}
+
+func (locker *localLocker) Lock(ctx context.Context, resource string, lifetime time.Duration) (uint64, error) {
+	reply, error := locker.dutex.Lock(LockArg{Resource: resource, Lifetime: lifetime}, "local")
+	return reply.Version, error
+}
+
+func (locker *localLocker) Unlock(ctx context.Context, resource string, version uint64) error {
+	_, error := locker.dutex.Unlock(UnlockArg{resource, version})
+	return error
+}
+
+func (locker *localLocker) RLock(ctx context.Context, resource string, lifetime time.Duration) (uint64, error) {
+	reply, error := locker.dutex.RLock(RLockArg{Resource: resource, Lifetime: lifetime}, "local")
+	return reply.Version, error
+}
+
+func (locker *localLocker) RUnlock(ctx context.Context, resource string, version uint64) error {
+	_, error := locker.dutex.RUnlock(RUnlockArg{resource, version})
+	return error
+}
+
+func (locker *localLocker) Refresh(ctx context.Context, resource string, version uint64, lifetime time.Duration) error {
+	_, error := locker.dutex.Refresh(RefreshArg{resource, version, lifetime})
+	return error
+}
+
+func (locker *localLocker) Close() error {
+	return nil
+}
+
+// httpLocker is a NetLocker backed by the versioned REST API. It keeps no
+// connection state of its own: every call is an independent HTTP request
+// against address, and reusing or redialing connections is left to the
+// http.Client's transport.
+type httpLocker struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newHTTPLocker(address string) *httpLocker {
+	return &httpLocker{
+		baseURL: "http://" + address + "/v1",
+		client:  &http.Client{},
+	}
+}
+
+func (locker *httpLocker) call(ctx context.Context, path string, arg interface{}, reply interface{}) error {
+	body, error := json.Marshal(arg)
+	if error != nil {
+		return error
+	}
+
+	request, error := http.NewRequestWithContext(ctx, http.MethodPost, locker.baseURL+path, bytes.NewReader(body))
+	if error != nil {
+		return error
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, error := locker.client.Do(request)
+	if error != nil {
+		return error
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("%s", bytes.TrimSpace(message))
+	}
+
+	return json.NewDecoder(response.Body).Decode(reply)
+}
+
+func (locker *httpLocker) Lock(ctx context.Context, resource string, lifetime time.Duration) (uint64, error) {
+	return locker.LockWithMetadata(ctx, resource, lifetime, "", "")
+}
+
+// LockWithMetadata is not part of NetLocker; it lets callers that want to
+// show up in List (notably the CLI's lock command) tag the acquisition with
+// a source and owner.
+func (locker *httpLocker) LockWithMetadata(ctx context.Context, resource string, lifetime time.Duration, source string, owner string) (uint64, error) {
+	var reply LockReply
+	error := locker.call(ctx, "/lock", LockArg{Resource: resource, Lifetime: lifetime, Source: source, Owner: owner}, &reply)
+	return reply.Version, error
+}
+
+// lockForQuorum is not part of NetLocker; it lets quorumLock tag every
+// server-side Lock with the same UID, purely so an operator can later
+// correlate which servers granted a given distributed lock via dutex list.
+func (locker *httpLocker) lockForQuorum(ctx context.Context, resource string, lifetime time.Duration, uid string) (uint64, error) {
+	var reply LockReply
+	error := locker.call(ctx, "/lock", LockArg{Resource: resource, Lifetime: lifetime, UID: uid}, &reply)
+	return reply.Version, error
+}
+
+func (locker *httpLocker) Unlock(ctx context.Context, resource string, version uint64) error {
+	var reply UnlockReply
+	return locker.call(ctx, "/unlock", UnlockArg{resource, version}, &reply)
+}
+
+func (locker *httpLocker) RLock(ctx context.Context, resource string, lifetime time.Duration) (uint64, error) {
+	return locker.RLockWithMetadata(ctx, resource, lifetime, "", "")
+}
+
+// RLockWithMetadata is not part of NetLocker; it lets callers that want to
+// show up in List (notably the CLI's rlock command) tag the acquisition with
+// a source and owner.
+func (locker *httpLocker) RLockWithMetadata(ctx context.Context, resource string, lifetime time.Duration, source string, owner string) (uint64, error) {
+	var reply RLockReply
+	error := locker.call(ctx, "/rlock", RLockArg{Resource: resource, Lifetime: lifetime, Source: source, Owner: owner}, &reply)
+	return reply.Version, error
+}
+
+func (locker *httpLocker) RUnlock(ctx context.Context, resource string, version uint64) error {
+	var reply RUnlockReply
+	return locker.call(ctx, "/runlock", RUnlockArg{resource, version}, &reply)
+}
+
+func (locker *httpLocker) Refresh(ctx context.Context, resource string, version uint64, lifetime time.Duration) error {
+	var reply RefreshReply
+	return locker.call(ctx, "/refresh", RefreshArg{resource, version, lifetime}, &reply)
+}
+
+// LockBatch and UnlockBatch are not part of NetLocker, since quorum/fan-out
+// callers act on one resource at a time, but the REST client still exposes
+// them for the CLI's lock-batch/unlock-batch commands.
+func (locker *httpLocker) LockBatch(ctx context.Context, resources []string, lifetime time.Duration, source string, owner string) (map[string]uint64, error) {
+	var reply LockBatchReply
+	error := locker.call(ctx, "/lock-batch", LockBatchArg{Resources: resources, Lifetime: lifetime, Source: source, Owner: owner}, &reply)
+	return reply.Versions, error
+}
+
+func (locker *httpLocker) UnlockBatch(ctx context.Context, resources []string, versions map[string]uint64) error {
+	var reply UnlockBatchReply
+	return locker.call(ctx, "/unlock-batch", UnlockBatchArg{resources, versions}, &reply)
+}
+
+// List is not part of NetLocker either; it is an introspection query rather
+// than a lock operation, used by the CLI's list command.
+func (locker *httpLocker) List(ctx context.Context) (ListReply, error) {
+	request, error := http.NewRequestWithContext(ctx, http.MethodGet, locker.baseURL+"/list", nil)
+	if error != nil {
+		return ListReply{}, error
+	}
+
+	response, error := locker.client.Do(request)
+	if error != nil {
+		return ListReply{}, error
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(response.Body)
+		return ListReply{}, fmt.Errorf("%s", bytes.TrimSpace(message))
+	}
+
+	var reply ListReply
+	error = json.NewDecoder(response.Body).Decode(&reply)
+	return reply, error
+}
+
+func (locker *httpLocker) Close() error {
+	return nil
+}
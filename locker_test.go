@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalLockerSatisfiesNetLocker(t *testing.T) {
+	var locker NetLocker = newLocalLocker(newDutex())
+	defer locker.Close()
+
+	ctx := context.Background()
+
+	version, error := locker.Lock(ctx, "resource", time.Minute)
+	if error != nil {
+		t.Fatalf("Lock: %v", error)
+	}
+
+	if _, error := locker.Lock(ctx, "resource", time.Minute); error == nil {
+		t.Fatalf("expected a second Lock to fail while the first is held")
+	}
+
+	if error := locker.Unlock(ctx, "resource", version); error != nil {
+		t.Fatalf("Unlock: %v", error)
+	}
+
+	if _, error := locker.Lock(ctx, "resource", time.Minute); error != nil {
+		t.Fatalf("expected Lock to succeed after Unlock, got: %v", error)
+	}
+}
@@ -1,121 +1,173 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"net"
-	"net/http"
-	"net/rpc"
 	"os"
-	"sync"
 	"time"
 
 	"github.com/urfave/cli/v2"
 )
 
-type Resource struct {
-	version    uint64
-	expiration time.Time
-}
+func lock(address string, resource string, lifetime time.Duration, source string, owner string) error {
+	locker := newHTTPLocker(address)
+	defer locker.Close()
 
-type Dutex struct {
-	mutex   sync.Mutex
-	locked  map[string]Resource
-	version uint64
-}
+	version, error := locker.LockWithMetadata(context.Background(), resource, lifetime, source, owner)
+	if error != nil {
+		return error
+	}
 
-func newDutex() *Dutex {
-	return &Dutex{locked: make(map[string]Resource)}
+	fmt.Printf("Successfully locked %s version %d.\n", resource, version)
+	return nil
 }
 
-type LockArg struct {
-	Resource string
-	Lifetime time.Duration
-}
+func list(address string) error {
+	locker := newHTTPLocker(address)
+	defer locker.Close()
 
-func (dutex *Dutex) Lock(arg LockArg, version *uint64) error {
-	dutex.mutex.Lock()
-	defer dutex.mutex.Unlock()
+	reply, error := locker.List(context.Background())
+	if error != nil {
+		return error
+	}
 
-	previous, ok := dutex.locked[arg.Resource]
-	if ok && time.Now().Before(previous.expiration) {
-		return fmt.Errorf("%s is already locked.", arg.Resource)
+	for _, entry := range reply.Resources {
+		fmt.Printf("%s %s version %d uid=%q owner=%q source=%q client=%s acquired=%s expiration=%s\n",
+			entry.Resource,
+			entry.Mode,
+			entry.Version,
+			entry.UID,
+			entry.Owner,
+			entry.Source,
+			entry.Client,
+			entry.Acquired.Format(time.RFC3339),
+			entry.Expiration.Format(time.RFC3339))
 	}
+	return nil
+}
 
-	expiration := time.Now().Add(arg.Lifetime)
+func unlock(address string, resource string, version uint64) error {
+	locker := newHTTPLocker(address)
+	defer locker.Close()
 
-	dutex.version++
-	dutex.locked[arg.Resource] = Resource{dutex.version, expiration}
+	error := locker.Unlock(context.Background(), resource, version)
+	if error != nil {
+		return error
+	}
 
-	*version = dutex.version
+	fmt.Printf("Successfully unlocked %s version %d.\n", resource, version)
 	return nil
 }
 
-type UnlockArg struct {
-	Resource string
-	Version  uint64
-}
+func refresh(address string, resource string, version uint64, lifetime time.Duration) error {
+	locker := newHTTPLocker(address)
+	defer locker.Close()
 
-type UnlockReply struct {}
+	error := locker.Refresh(context.Background(), resource, version, lifetime)
+	if error != nil {
+		return error
+	}
 
-func (dutex *Dutex) Unlock(arg UnlockArg, _ *UnlockReply) error {
-	dutex.mutex.Lock()
-	defer dutex.mutex.Unlock()
+	fmt.Printf("Successfully refreshed %s version %d.\n", resource, version)
+	return nil
+}
 
-	previous, ok := dutex.locked[arg.Resource]
-	if !ok {
-		return fmt.Errorf("%s is already unlocked", arg.Resource)
-	}
-	if arg.Version != previous.version {
-		return fmt.Errorf("expected version %d, got version %d",
-			uint64(previous.version),
-			uint64(arg.Version))
+func rlock(address string, resource string, lifetime time.Duration, source string, owner string) error {
+	locker := newHTTPLocker(address)
+	defer locker.Close()
+
+	version, error := locker.RLockWithMetadata(context.Background(), resource, lifetime, source, owner)
+	if error != nil {
+		return error
 	}
 
-	delete(dutex.locked, arg.Resource)
+	fmt.Printf("Successfully rlocked %s version %d.\n", resource, version)
 	return nil
 }
 
-func startServer(address string) error {
-	dutex := newDutex()
-	rpc.Register(dutex)
-	rpc.HandleHTTP()
-	listener, error := net.Listen("tcp", address)
+func runlock(address string, resource string, version uint64) error {
+	locker := newHTTPLocker(address)
+	defer locker.Close()
+
+	error := locker.RUnlock(context.Background(), resource, version)
 	if error != nil {
 		return error
 	}
-	return http.Serve(listener, nil)
+
+	fmt.Printf("Successfully runlocked %s version %d.\n", resource, version)
+	return nil
 }
 
-func lock(address string, resource string, lifetime time.Duration) error {
-	client, error := rpc.DialHTTP("tcp", address)
+func lockBatch(address string, resources []string, lifetime time.Duration, source string, owner string) error {
+	locker := newHTTPLocker(address)
+	defer locker.Close()
+
+	versions, error := locker.LockBatch(context.Background(), resources, lifetime, source, owner)
 	if error != nil {
 		return error
 	}
 
-	var version uint64
-	error = client.Call("Dutex.Lock", LockArg{resource, lifetime}, &version)
+	for _, resource := range resources {
+		fmt.Printf("Successfully locked %s version %d.\n", resource, versions[resource])
+	}
+	return nil
+}
+
+func qlock(addresses []string, resource string, lifetime time.Duration) error {
+	targets := newQuorumTargets(addresses)
+	defer closeQuorumTargets(targets)
+
+	versions, error := quorumLock(targets, resource, lifetime)
 	if error != nil {
 		return error
 	}
 
-	fmt.Printf("Successfully locked %s version %d.\n", resource, uint64(version))
+	for _, address := range addresses {
+		version, ok := versions[address]
+		if !ok {
+			continue
+		}
+		fmt.Printf("Successfully qlocked %s version %d on %s.\n", resource, version, address)
+	}
 	return nil
 }
 
-func unlock(address string, resource string, version uint64) error {
-	client, error := rpc.DialHTTP("tcp", address)
-	if error != nil {
+func qunlock(addresses []string, resource string, versionList []uint64) error {
+	if len(versionList) != len(addresses) {
+		return fmt.Errorf("expected %d versions, got %d", len(addresses), len(versionList))
+	}
+
+	versions := make(map[string]uint64, len(addresses))
+	for i, address := range addresses {
+		versions[address] = versionList[i]
+	}
+
+	targets := newQuorumTargets(addresses)
+	defer closeQuorumTargets(targets)
+
+	if error := quorumUnlock(targets, versions, resource); error != nil {
 		return error
 	}
 
-	var reply UnlockReply
-	error = client.Call("Dutex.Unlock", UnlockArg{resource, version}, &reply)
+	for _, address := range addresses {
+		fmt.Printf("Successfully qunlocked %s version %d on %s.\n", resource, versions[address], address)
+	}
+	return nil
+}
+
+func unlockBatch(address string, resources []string, versions map[string]uint64) error {
+	locker := newHTTPLocker(address)
+	defer locker.Close()
+
+	error := locker.UnlockBatch(context.Background(), resources, versions)
 	if error != nil {
 		return error
 	}
 
-	fmt.Printf("Successfully unlocked %s version %d.\n", resource, uint64(version))
+	for _, resource := range resources {
+		fmt.Printf("Successfully unlocked %s version %d.\n", resource, versions[resource])
+	}
 	return nil
 }
 
@@ -124,11 +176,11 @@ func main() {
 		Commands: []*cli.Command{
 			{
 				Name:  "server",
-				Usage: "Run the dutex rpc server",
+				Usage: "Run the dutex rest server",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:     "address",
-						Usage:    "address rpc server should bind to",
+						Usage:    "address rest server should bind to",
 						Required: true,
 					},
 				},
@@ -138,11 +190,11 @@ func main() {
 			},
 			{
 				Name:  "lock",
-				Usage: "Call the lock rpc",
+				Usage: "Call the /v1/lock endpoint",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:     "address",
-						Usage:    "address of rpc server",
+						Usage:    "address of rest server",
 						Required: true,
 					},
 					&cli.StringFlag{
@@ -155,6 +207,14 @@ func main() {
 						Value: "1m",
 						Usage: "maximum time lock will be held for",
 					},
+					&cli.StringFlag{
+						Name:  "source",
+						Usage: "file:line or other source tag to record with the lock, shown by dutex list",
+					},
+					&cli.StringFlag{
+						Name:  "owner",
+						Usage: "user tag to record with the lock, shown by dutex list",
+					},
 				},
 				Action: func(context *cli.Context) error {
 					address := context.String("address")
@@ -164,16 +224,16 @@ func main() {
 						return error
 					}
 
-					return lock(address, resource, lifetime)
+					return lock(address, resource, lifetime, context.String("source"), context.String("owner"))
 				},
 			},
 			{
 				Name:  "unlock",
-				Usage: "Call the unlock rpc",
+				Usage: "Call the /v1/unlock endpoint",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:     "address",
-						Usage:    "address of rpc server",
+						Usage:    "address of rest server",
 						Required: true,
 					},
 					&cli.StringFlag{
@@ -194,6 +254,257 @@ func main() {
 					return unlock(address, resource, version)
 				},
 			},
+			{
+				Name:  "refresh",
+				Usage: "Call the /v1/refresh endpoint",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address of rest server",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "resource",
+						Usage:    "name of the resource to refresh",
+						Required: true,
+					},
+					&cli.Uint64Flag{
+						Name:     "version",
+						Usage:    "the version that was locked",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "lifetime",
+						Value: "1m",
+						Usage: "maximum additional time lock will be held for",
+					},
+				},
+				Action: func(context *cli.Context) error {
+					address := context.String("address")
+					resource := context.String("resource")
+					version := context.Uint64("version")
+					lifetime, error := time.ParseDuration(context.String("lifetime"))
+					if error != nil {
+						return error
+					}
+
+					return refresh(address, resource, version, lifetime)
+				},
+			},
+			{
+				Name:  "rlock",
+				Usage: "Call the /v1/rlock endpoint",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address of rest server",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "resource",
+						Usage:    "name of the resource to rlock",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "lifetime",
+						Value: "1m",
+						Usage: "maximum time lock will be held for",
+					},
+					&cli.StringFlag{
+						Name:  "source",
+						Usage: "file:line or other source tag to record with the lock, shown by dutex list",
+					},
+					&cli.StringFlag{
+						Name:  "owner",
+						Usage: "user tag to record with the lock, shown by dutex list",
+					},
+				},
+				Action: func(context *cli.Context) error {
+					address := context.String("address")
+					resource := context.String("resource")
+					lifetime, error := time.ParseDuration(context.String("lifetime"))
+					if error != nil {
+						return error
+					}
+
+					return rlock(address, resource, lifetime, context.String("source"), context.String("owner"))
+				},
+			},
+			{
+				Name:  "runlock",
+				Usage: "Call the /v1/runlock endpoint",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address of rest server",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "resource",
+						Usage:    "name of the resource to runlock",
+						Required: true,
+					},
+					&cli.Uint64Flag{
+						Name:  "version",
+						Usage: "the version that was rlocked",
+					},
+				},
+				Action: func(context *cli.Context) error {
+					address := context.String("address")
+					resource := context.String("resource")
+					version := context.Uint64("version")
+
+					return runlock(address, resource, version)
+				},
+			},
+			{
+				Name:  "lock-batch",
+				Usage: "Call the /v1/lock-batch endpoint",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address of rest server",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:     "resource",
+						Usage:    "name of a resource to lock, may be repeated",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "lifetime",
+						Value: "1m",
+						Usage: "maximum time lock will be held for",
+					},
+					&cli.StringFlag{
+						Name:  "source",
+						Usage: "file:line or other source tag to record with the locks, shown by dutex list",
+					},
+					&cli.StringFlag{
+						Name:  "owner",
+						Usage: "user tag to record with the locks, shown by dutex list",
+					},
+				},
+				Action: func(context *cli.Context) error {
+					address := context.String("address")
+					resources := context.StringSlice("resource")
+					lifetime, error := time.ParseDuration(context.String("lifetime"))
+					if error != nil {
+						return error
+					}
+
+					return lockBatch(address, resources, lifetime, context.String("source"), context.String("owner"))
+				},
+			},
+			{
+				Name:  "unlock-batch",
+				Usage: "Call the /v1/unlock-batch endpoint",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address of rest server",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:     "resource",
+						Usage:    "name of a resource to unlock, may be repeated",
+						Required: true,
+					},
+					&cli.Uint64SliceFlag{
+						Name:     "version",
+						Usage:    "the version that was locked, one per resource in the same order",
+						Required: true,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					address := context.String("address")
+					resources := context.StringSlice("resource")
+					versionList := context.Uint64Slice("version")
+					if len(versionList) != len(resources) {
+						return fmt.Errorf("expected %d versions, got %d", len(resources), len(versionList))
+					}
+
+					versions := make(map[string]uint64, len(resources))
+					for i, resource := range resources {
+						versions[resource] = uint64(versionList[i])
+					}
+
+					return unlockBatch(address, resources, versions)
+				},
+			},
+			{
+				Name:  "qlock",
+				Usage: "Call the /v1/lock endpoint against a quorum of servers",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "address",
+						Usage:    "address of a server in the quorum, may be repeated or comma-separated",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "resource",
+						Usage:    "name of the resource to lock",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "lifetime",
+						Value: "1m",
+						Usage: "maximum time lock will be held for",
+					},
+				},
+				Action: func(context *cli.Context) error {
+					addresses := splitAddresses(context.StringSlice("address"))
+					resource := context.String("resource")
+					lifetime, error := time.ParseDuration(context.String("lifetime"))
+					if error != nil {
+						return error
+					}
+
+					return qlock(addresses, resource, lifetime)
+				},
+			},
+			{
+				Name:  "qunlock",
+				Usage: "Call the /v1/unlock endpoint against a quorum of servers",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "address",
+						Usage:    "address of a server that granted the lock, may be repeated or comma-separated",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "resource",
+						Usage:    "name of the resource to unlock",
+						Required: true,
+					},
+					&cli.Uint64SliceFlag{
+						Name:     "version",
+						Usage:    "the version granted by each address, in the same order",
+						Required: true,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					addresses := splitAddresses(context.StringSlice("address"))
+					resource := context.String("resource")
+					versionList := context.Uint64Slice("version")
+
+					return qunlock(addresses, resource, versionList)
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "Call the /v1/list endpoint",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "address",
+						Usage:    "address of rest server",
+						Required: true,
+					},
+				},
+				Action: func(context *cli.Context) error {
+					return list(context.String("address"))
+				},
+			},
 		},
 	}
 
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// splitAddresses expands a CLI address list that may mix repeated flags with
+// comma-separated values into a flat slice of addresses.
+func splitAddresses(raw []string) []string {
+	var addresses []string
+	for _, item := range raw {
+		for _, address := range strings.Split(item, ",") {
+			address = strings.TrimSpace(address)
+			if address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	return addresses
+}
+
+func generateUID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, error := rand.Read(buffer); error != nil {
+		return "", error
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// quorumLocker is the seam quorumLock/quorumUnlock need from a server
+// connection: an exclusive lock tagged with a UID (so an operator can later
+// correlate which servers granted a distributed lock via dutex list) and a
+// matching unlock. httpLocker satisfies it for real servers; tests substitute
+// a fake so the fan-out/rollback logic can be exercised without a listener.
+type quorumLocker interface {
+	lockForQuorum(ctx context.Context, resource string, lifetime time.Duration, uid string) (uint64, error)
+	Unlock(ctx context.Context, resource string, version uint64) error
+	Close() error
+}
+
+// quorumTarget names a quorumLocker so versions granted by different servers
+// can be reported and matched back up when unlocking.
+type quorumTarget struct {
+	name   string
+	locker quorumLocker
+}
+
+func newQuorumTargets(addresses []string) []quorumTarget {
+	targets := make([]quorumTarget, len(addresses))
+	for i, address := range addresses {
+		targets[i] = quorumTarget{name: address, locker: newHTTPLocker(address)}
+	}
+	return targets
+}
+
+func closeQuorumTargets(targets []quorumTarget) {
+	for _, target := range targets {
+		target.locker.Close()
+	}
+}
+
+// quorumLock fans a Lock request out to every target and considers the
+// resource acquired once a quorum (N/2 + 1) of them grant it. On partial
+// success it releases the successful subset before returning an error, so a
+// failed quorum never leaves a minority of servers holding a stale lock.
+func quorumLock(targets []quorumTarget, resource string, lifetime time.Duration) (map[string]uint64, error) {
+	uid, err := generateUID()
+	if err != nil {
+		return nil, err
+	}
+
+	type grant struct {
+		name    string
+		version uint64
+		error   error
+	}
+
+	ctx := context.Background()
+	grants := make(chan grant, len(targets))
+	for _, target := range targets {
+		target := target
+		go func() {
+			version, error := target.locker.lockForQuorum(ctx, resource, lifetime, uid)
+			grants <- grant{target.name, version, error}
+		}()
+	}
+
+	versions := make(map[string]uint64, len(targets))
+	for range targets {
+		g := <-grants
+		if g.error == nil {
+			versions[g.name] = g.version
+		}
+	}
+
+	need := len(targets)/2 + 1
+	if len(versions) >= need {
+		return versions, nil
+	}
+
+	quorumUnlock(targets, versions, resource)
+	return nil, fmt.Errorf("failed to acquire quorum lock on %s: only %d/%d servers granted it",
+		resource, len(versions), len(targets))
+}
+
+// quorumUnlock releases resource on every target named in versions, best
+// effort: it tries every such target even if some fail, and returns the first
+// error it sees. Targets not named in versions are left untouched.
+func quorumUnlock(targets []quorumTarget, versions map[string]uint64, resource string) error {
+	ctx := context.Background()
+
+	var wait sync.WaitGroup
+	errors := make(chan error, len(versions))
+	for _, target := range targets {
+		version, ok := versions[target.name]
+		if !ok {
+			continue
+		}
+
+		target, version := target, version
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			errors <- target.locker.Unlock(ctx, resource, version)
+		}()
+	}
+	wait.Wait()
+	close(errors)
+
+	for error := range errors {
+		if error != nil {
+			return error
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeQuorumLocker is a quorumLocker whose lockForQuorum always grants (or
+// always fails, if fail is set) and whose Unlock just records the versions it
+// is called with, so tests can
+// exercise quorumLock/quorumUnlock without a listener.
+type fakeQuorumLocker struct {
+	fail bool
+
+	mutex    sync.Mutex
+	unlocked []uint64
+}
+
+func (locker *fakeQuorumLocker) lockForQuorum(ctx context.Context, resource string, lifetime time.Duration, uid string) (uint64, error) {
+	if locker.fail {
+		return 0, fmt.Errorf("%s is already locked.", resource)
+	}
+	return 1, nil
+}
+
+func (locker *fakeQuorumLocker) Unlock(ctx context.Context, resource string, version uint64) error {
+	locker.mutex.Lock()
+	defer locker.mutex.Unlock()
+	locker.unlocked = append(locker.unlocked, version)
+	return nil
+}
+
+func (locker *fakeQuorumLocker) Close() error {
+	return nil
+}
+
+func TestQuorumLockSucceedsWithMajority(t *testing.T) {
+	fakes := []*fakeQuorumLocker{{}, {}, {fail: true}}
+	targets := []quorumTarget{
+		{name: "a", locker: fakes[0]},
+		{name: "b", locker: fakes[1]},
+		{name: "c", locker: fakes[2]},
+	}
+
+	versions, error := quorumLock(targets, "resource", time.Minute)
+	if error != nil {
+		t.Fatalf("quorumLock: %v", error)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 granted versions, got %d", len(versions))
+	}
+	if _, ok := versions["c"]; ok {
+		t.Fatalf("did not expect c to have granted a lock")
+	}
+
+	for i, fake := range fakes {
+		if len(fake.unlocked) != 0 {
+			t.Fatalf("target %d: expected no rollback when quorum is reached", i)
+		}
+	}
+}
+
+func TestQuorumLockRollsBackOnMinority(t *testing.T) {
+	fakes := []*fakeQuorumLocker{{}, {fail: true}, {fail: true}}
+	targets := []quorumTarget{
+		{name: "a", locker: fakes[0]},
+		{name: "b", locker: fakes[1]},
+		{name: "c", locker: fakes[2]},
+	}
+
+	_, error := quorumLock(targets, "resource", time.Minute)
+	if error == nil {
+		t.Fatalf("expected quorumLock to fail when only a minority grants")
+	}
+
+	if len(fakes[0].unlocked) != 1 {
+		t.Fatalf("expected the lone grant on a to be rolled back, got %v", fakes[0].unlocked)
+	}
+	if len(fakes[1].unlocked) != 0 || len(fakes[2].unlocked) != 0 {
+		t.Fatalf("did not expect Unlock on targets that never granted a lock")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// decode rejects anything but POST, then decodes the JSON request body into
+// arg. It reports false (having already written the response) on failure.
+func decode(w http.ResponseWriter, r *http.Request, arg interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	if error := json.NewDecoder(r.Body).Decode(arg); error != nil {
+		http.Error(w, error.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func handleLock(dutex *Dutex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var arg LockArg
+		if !decode(w, r, &arg) {
+			return
+		}
+
+		reply, error := dutex.Lock(arg, r.RemoteAddr)
+		if error != nil {
+			http.Error(w, error.Error(), http.StatusConflict)
+			return
+		}
+
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func handleUnlock(dutex *Dutex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var arg UnlockArg
+		if !decode(w, r, &arg) {
+			return
+		}
+
+		reply, error := dutex.Unlock(arg)
+		if error != nil {
+			http.Error(w, error.Error(), http.StatusConflict)
+			return
+		}
+
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func handleRLock(dutex *Dutex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var arg RLockArg
+		if !decode(w, r, &arg) {
+			return
+		}
+
+		reply, error := dutex.RLock(arg, r.RemoteAddr)
+		if error != nil {
+			http.Error(w, error.Error(), http.StatusConflict)
+			return
+		}
+
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func handleRUnlock(dutex *Dutex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var arg RUnlockArg
+		if !decode(w, r, &arg) {
+			return
+		}
+
+		reply, error := dutex.RUnlock(arg)
+		if error != nil {
+			http.Error(w, error.Error(), http.StatusConflict)
+			return
+		}
+
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func handleRefresh(dutex *Dutex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var arg RefreshArg
+		if !decode(w, r, &arg) {
+			return
+		}
+
+		reply, error := dutex.Refresh(arg)
+		if error != nil {
+			http.Error(w, error.Error(), http.StatusConflict)
+			return
+		}
+
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func handleLockBatch(dutex *Dutex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var arg LockBatchArg
+		if !decode(w, r, &arg) {
+			return
+		}
+
+		reply, error := dutex.LockBatch(arg, r.RemoteAddr)
+		if error != nil {
+			http.Error(w, error.Error(), http.StatusConflict)
+			return
+		}
+
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func handleUnlockBatch(dutex *Dutex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var arg UnlockBatchArg
+		if !decode(w, r, &arg) {
+			return
+		}
+
+		reply, error := dutex.UnlockBatch(arg)
+		if error != nil {
+			http.Error(w, error.Error(), http.StatusConflict)
+			return
+		}
+
+		json.NewEncoder(w).Encode(reply)
+	}
+}
+
+func handleList(dutex *Dutex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		json.NewEncoder(w).Encode(dutex.List())
+	}
+}
+
+// newMux wires every REST handler up to dutex. It is split out from
+// startServer so tests can drive the handlers with an httptest.Server
+// instead of binding a real listener.
+func newMux(dutex *Dutex) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/lock", handleLock(dutex))
+	mux.HandleFunc("/v1/unlock", handleUnlock(dutex))
+	mux.HandleFunc("/v1/rlock", handleRLock(dutex))
+	mux.HandleFunc("/v1/runlock", handleRUnlock(dutex))
+	mux.HandleFunc("/v1/refresh", handleRefresh(dutex))
+	mux.HandleFunc("/v1/lock-batch", handleLockBatch(dutex))
+	mux.HandleFunc("/v1/unlock-batch", handleUnlockBatch(dutex))
+	mux.HandleFunc("/v1/list", handleList(dutex))
+	return mux
+}
+
+func startServer(address string) error {
+	return http.ListenAndServe(address, newMux(newDutex()))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func postJSON(t *testing.T, server *httptest.Server, path string, arg interface{}) *http.Response {
+	t.Helper()
+
+	body, error := json.Marshal(arg)
+	if error != nil {
+		t.Fatalf("Marshal: %v", error)
+	}
+
+	response, error := http.Post(server.URL+path, "application/json", bytes.NewReader(body))
+	if error != nil {
+		t.Fatalf("Post %s: %v", path, error)
+	}
+	return response
+}
+
+func TestHandleLockRejectsNonPOST(t *testing.T) {
+	server := httptest.NewServer(newMux(newDutex()))
+	defer server.Close()
+
+	response, error := http.Get(server.URL + "/v1/lock")
+	if error != nil {
+		t.Fatalf("Get: %v", error)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected %d, got %d", http.StatusMethodNotAllowed, response.StatusCode)
+	}
+}
+
+func TestHandleLockAndListOverHTTP(t *testing.T) {
+	server := httptest.NewServer(newMux(newDutex()))
+	defer server.Close()
+
+	response := postJSON(t, server, "/v1/lock", LockArg{Resource: "a", Lifetime: time.Minute, Owner: "alice"})
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, response.StatusCode)
+	}
+
+	var lockReply LockReply
+	if error := json.NewDecoder(response.Body).Decode(&lockReply); error != nil {
+		t.Fatalf("Decode: %v", error)
+	}
+	if lockReply.Version == 0 {
+		t.Fatalf("expected a non-zero version")
+	}
+
+	conflict := postJSON(t, server, "/v1/lock", LockArg{Resource: "a", Lifetime: time.Minute})
+	defer conflict.Body.Close()
+	if conflict.StatusCode != http.StatusConflict {
+		t.Fatalf("expected %d on double lock, got %d", http.StatusConflict, conflict.StatusCode)
+	}
+
+	listResponse, error := http.Get(server.URL + "/v1/list")
+	if error != nil {
+		t.Fatalf("Get /v1/list: %v", error)
+	}
+	defer listResponse.Body.Close()
+
+	var listReply ListReply
+	if error := json.NewDecoder(listResponse.Body).Decode(&listReply); error != nil {
+		t.Fatalf("Decode: %v", error)
+	}
+	if len(listReply.Resources) != 1 || listReply.Resources[0].Owner != "alice" {
+		t.Fatalf("expected list to show the lock owned by alice, got %+v", listReply.Resources)
+	}
+}
+
+func TestHandleLockRejectsBadJSON(t *testing.T) {
+	server := httptest.NewServer(newMux(newDutex()))
+	defer server.Close()
+
+	response, error := http.Post(server.URL+"/v1/lock", "application/json", bytes.NewReader([]byte("not json")))
+	if error != nil {
+		t.Fatalf("Post: %v", error)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected %d, got %d", http.StatusBadRequest, response.StatusCode)
+	}
+}